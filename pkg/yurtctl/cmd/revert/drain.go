@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revert
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+)
+
+const (
+	nodeRevertEventSource = "yurtctl-revert"
+)
+
+// cordonNode marks node as unschedulable so the scheduler stops placing
+// new pods on it while it is being drained.
+func cordonNode(ro *RevertOptions, nodeName string) error {
+	return ro.mutateNode(nodeName, func(n *v1.Node) {
+		n.Spec.Unschedulable = true
+	})
+}
+
+// uncordonNode reverses cordonNode once the yurt-hub-removal servant job
+// has finished with the node.
+func uncordonNode(ro *RevertOptions, nodeName string) error {
+	return ro.mutateNode(nodeName, func(n *v1.Node) {
+		n.Spec.Unschedulable = false
+	})
+}
+
+// evictNodePods evicts every non-DaemonSet pod running on nodeName,
+// honoring PodDisruptionBudgets via the eviction subresource. If the
+// eviction subresource is not available on the server it falls back to a
+// plain delete, matching what `kubectl drain` does.
+//
+// deadline is the single point in time by which the whole drain
+// (eviction plus waitForPodsGone) must finish, per --drain-timeout. Each
+// pod's eviction retry is bounded by the time remaining until deadline,
+// not a fresh DrainTimeout per pod, so a node with several PDB-blocked
+// pods still finishes within one drain budget instead of N of them.
+func evictNodePods(ro *RevertOptions, nodeName string, deadline time.Time) error {
+	podLst, err := ro.clientSet.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("fail to list pods on node/%s: %s", nodeName, err)
+	}
+
+	for i := range podLst.Items {
+		pod := &podLst.Items[i]
+		if isDaemonSetPod(pod) {
+			continue
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("drain timeout exceeded before evicting pod %s/%s", pod.Namespace, pod.Name)
+		}
+		if err := ro.mutateWithTimeout(remaining, func() error {
+			evictErr := ro.clientSet.PolicyV1beta1().Evictions(pod.Namespace).Evict(&policyv1beta1.Eviction{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      pod.Name,
+					Namespace: pod.Namespace,
+				},
+			})
+			if apierrors.IsNotFound(evictErr) {
+				// the eviction subresource isn't registered on this
+				// server, fall back to a plain delete
+				return ro.clientSet.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{})
+			}
+			return evictErr
+		}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("fail to evict pod %s/%s: %s", pod.Namespace, pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// waitForPodsGone polls until no non-DaemonSet pod is left scheduled on
+// nodeName, or deadline elapses.
+func waitForPodsGone(ro *RevertOptions, nodeName string, deadline time.Time) error {
+	return wait.PollImmediate(2*time.Second, time.Until(deadline), func() (bool, error) {
+		podLst, err := ro.clientSet.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+		})
+		if err != nil {
+			return false, err
+		}
+		for i := range podLst.Items {
+			if !isDaemonSetPod(&podLst.Items[i]) {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+func isDaemonSetPod(pod *v1.Pod) bool {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
+
+// recordNodeEvent emits an Event against the Node object so that
+// `kubectl describe node` shows the revert's progress on it.
+func recordNodeEvent(ro *RevertOptions, nodeName, reason, message string) {
+	node, err := ro.clientSet.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		klog.Errorf("fail to get node/%s to record event %q: %s", nodeName, reason, err)
+		return
+	}
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s-", nodeName),
+			Namespace:    metav1.NamespaceDefault,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "Node",
+			Name:      node.Name,
+			UID:       node.UID,
+			Namespace: metav1.NamespaceDefault,
+		},
+		Reason:         reason,
+		Message:        message,
+		Source:         v1.EventSource{Component: nodeRevertEventSource},
+		FirstTimestamp: metav1.Now(),
+		LastTimestamp:  metav1.Now(),
+		Type:           v1.EventTypeNormal,
+	}
+	if _, err := ro.clientSet.CoreV1().Events(metav1.NamespaceDefault).Create(event); err != nil {
+		klog.Errorf("fail to record event %q on node/%s: %s", reason, nodeName, err)
+	}
+}
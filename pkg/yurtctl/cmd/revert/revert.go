@@ -18,6 +18,8 @@ package revert
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -27,16 +29,91 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog"
 
-	"github.com/alibaba/openyurt/pkg/projectinfo"
 	"github.com/alibaba/openyurt/pkg/yurtctl/constants"
 	"github.com/alibaba/openyurt/pkg/yurtctl/lock"
 	kubeutil "github.com/alibaba/openyurt/pkg/yurtctl/util/kubernetes"
+	"github.com/alibaba/openyurt/pkg/yurtctl/util/kubernetes/retry"
 )
 
 // ConvertOptions has the information required by the revert operation
 type RevertOptions struct {
 	clientSet           *kubernetes.Clientset
 	YurtctlServantImage string
+	// DryRun, when true, makes every registered step only report the
+	// mutations it would perform instead of performing them. Steps still
+	// read cluster state (e.g. the node list) to work out those mutations.
+	DryRun bool
+	// Skip is the set of step names to exclude from this run.
+	Skip []string
+	// Only, when non-empty, restricts the run to exactly these step
+	// names (in registry order).
+	Only []string
+	// ResumeFrom re-runs the flow starting at the named step: every step
+	// before it is skipped as already completed without checking the
+	// persisted state, and steps from it on that the persisted state marks
+	// as completed are skipped too.
+	ResumeFrom string
+	// MaxRetries bounds how many times a single mutating call is retried
+	// on a transient error before the step gives up.
+	MaxRetries int
+	// RetryTimeout bounds the total time spent retrying a single
+	// mutating call.
+	RetryTimeout time.Duration
+	// DrainEdgeNodes, when true, cordons and evicts each edge node
+	// before the yurt-hub-removal servant job runs against it, and
+	// uncordons it afterwards.
+	DrainEdgeNodes bool
+	// DrainTimeout bounds how long to wait for a node's pods to be
+	// evicted before giving up on draining that node.
+	DrainTimeout time.Duration
+
+	// edgeNodeNames is threaded between steps: remove-edge-label
+	// populates it and run-servant-job consumes it.
+	edgeNodeNames []string
+}
+
+// mutate retries fn according to ro.MaxRetries/ro.RetryTimeout, so every
+// step can route its Delete/Update/Create calls through the same retry
+// policy instead of failing on the first transient error.
+func (ro *RevertOptions) mutate(fn func() error) error {
+	return ro.mutateWithTimeout(ro.RetryTimeout, fn)
+}
+
+// mutateWithTimeout behaves like mutate but bounds the retry loop by
+// timeout instead of ro.RetryTimeout, for callers whose mutation has its
+// own, independently-configured retry budget (e.g. eviction, which is
+// bounded by --drain-timeout since a PDB can legitimately hold an
+// eviction retrying for the whole drain, not just a generic mutation).
+func (ro *RevertOptions) mutateWithTimeout(timeout time.Duration, fn func() error) error {
+	backoff := retry.DefaultBackoff
+	backoff.Steps = ro.retrySteps()
+	return retry.OnErrorWithTimeout(timeout, backoff, func(error) bool { return false }, fn)
+}
+
+// retrySteps returns the number of attempts a mutation should make: the
+// first try plus ro.MaxRetries retries, or 1 (try exactly once, no
+// retries) if they set --max-retries=0 or left it unset.
+func (ro *RevertOptions) retrySteps() int {
+	if ro.MaxRetries > 0 {
+		return ro.MaxRetries + 1
+	}
+	return 1
+}
+
+// mutateNode retries a Node update against conflicts, re-fetching the node
+// and re-applying modify before each attempt.
+func (ro *RevertOptions) mutateNode(name string, modify func(node *v1.Node)) error {
+	backoff := retry.DefaultBackoff
+	backoff.Steps = ro.retrySteps()
+	return retry.OnErrorWithTimeout(ro.RetryTimeout, backoff, apierrors.IsConflict, func() error {
+		node, err := ro.clientSet.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		modify(node)
+		_, err = ro.clientSet.CoreV1().Nodes().Update(node)
+		return err
+	})
 }
 
 // NewConvertOptions creates a new RevertOptions
@@ -63,6 +140,22 @@ func NewRevertCmd() *cobra.Command {
 	cmd.Flags().String("yurtctl-servant-image",
 		"openyurt/yurtctl-servant:latest",
 		"The yurtctl-servant image.")
+	cmd.Flags().Bool("dry-run", false,
+		"Print the mutations the revert would perform without making them; cluster state is still read to plan them.")
+	cmd.Flags().StringSlice("skip", nil,
+		"A comma-separated list of step names to skip.")
+	cmd.Flags().StringSlice("only", nil,
+		"A comma-separated list of step names to run, skipping all others.")
+	cmd.Flags().String("resume-from", "",
+		"Resume the revert starting at the named step, trusting that earlier steps already completed.")
+	cmd.Flags().Int("max-retries", 10,
+		"The maximum number of times a single mutating call is retried on a transient error.")
+	cmd.Flags().Duration("retry-timeout", 2*time.Minute,
+		"The maximum time spent retrying a single mutating call before giving up.")
+	cmd.Flags().Bool("drain-edge-nodes", true,
+		"Cordon, evict and uncordon each edge node around the yurt-hub removal, so running workloads aren't dropped mid-flight.")
+	cmd.Flags().Duration("drain-timeout", 5*time.Minute,
+		"The maximum time to wait for an edge node's pods to be evicted before failing the revert and uncordoning the node.")
 
 	return cmd
 }
@@ -75,6 +168,39 @@ func (ro *RevertOptions) Complete(flags *pflag.FlagSet) error {
 	}
 	ro.YurtctlServantImage = ycsi
 
+	ro.DryRun, err = flags.GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	ro.Skip, err = flags.GetStringSlice("skip")
+	if err != nil {
+		return err
+	}
+	ro.Only, err = flags.GetStringSlice("only")
+	if err != nil {
+		return err
+	}
+	ro.ResumeFrom, err = flags.GetString("resume-from")
+	if err != nil {
+		return err
+	}
+	ro.MaxRetries, err = flags.GetInt("max-retries")
+	if err != nil {
+		return err
+	}
+	ro.RetryTimeout, err = flags.GetDuration("retry-timeout")
+	if err != nil {
+		return err
+	}
+	ro.DrainEdgeNodes, err = flags.GetBool("drain-edge-nodes")
+	if err != nil {
+		return err
+	}
+	ro.DrainTimeout, err = flags.GetDuration("drain-timeout")
+	if err != nil {
+		return err
+	}
+
 	ro.clientSet, err = kubeutil.GenClientSet(flags)
 	if err != nil {
 		return err
@@ -82,7 +208,60 @@ func (ro *RevertOptions) Complete(flags *pflag.FlagSet) error {
 	return nil
 }
 
-// RunRevert reverts the target Yurt cluster back to a standard Kubernetes cluster
+// stepsToRun applies --skip, --only and --resume-from to the registered
+// steps and returns the ones that should actually execute, in order.
+func (ro *RevertOptions) stepsToRun() ([]RevertStep, error) {
+	all := RegisteredSteps()
+
+	only := map[string]bool{}
+	for _, name := range ro.Only {
+		only[name] = true
+	}
+	skip := map[string]bool{}
+	for _, name := range ro.Skip {
+		skip[name] = true
+	}
+
+	startIdx := 0
+	if ro.ResumeFrom != "" {
+		startIdx = -1
+		for i, s := range all {
+			if s.Name() == ro.ResumeFrom {
+				startIdx = i
+				break
+			}
+		}
+		if startIdx == -1 {
+			return nil, fmt.Errorf("unknown step %q for --resume-from, known steps: %s",
+				ro.ResumeFrom, stepNames(all))
+		}
+	}
+
+	var steps []RevertStep
+	for _, s := range all[startIdx:] {
+		if len(only) > 0 && !only[s.Name()] {
+			continue
+		}
+		if skip[s.Name()] {
+			continue
+		}
+		steps = append(steps, s)
+	}
+	return steps, nil
+}
+
+func stepNames(steps []RevertStep) string {
+	names := make([]string, 0, len(steps))
+	for _, s := range steps {
+		names = append(names, s.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+// RunRevert reverts the target Yurt cluster back to a standard Kubernetes
+// cluster by running the registered RevertSteps in order. Progress is
+// persisted as annotations on a ConfigMap in kube-system so a failed run
+// can be continued with --resume-from instead of starting over.
 func (ro *RevertOptions) RunRevert() (err error) {
 	if err = lock.AcquireLock(ro.clientSet); err != nil {
 		return
@@ -100,126 +279,104 @@ func (ro *RevertOptions) RunRevert() (err error) {
 	}
 	klog.V(4).Info("the server version is valid")
 
-	// 2. remove labels from nodes
-	nodeLst, err := ro.clientSet.CoreV1().Nodes().List(metav1.ListOptions{})
+	steps, err := ro.stepsToRun()
 	if err != nil {
-		return
+		return err
 	}
 
-	var edgeNodeNames []string
-	for _, node := range nodeLst.Items {
-		isEdgeNode, ok := node.Labels[projectinfo.GetEdgeWorkerLabelKey()]
-		if ok && isEdgeNode == "true" {
-			// cache edge nodes, we need to run servant job on each edge node later
-			edgeNodeNames = append(edgeNodeNames, node.GetName())
-			// remove the autonomy annotation, if found
-			_, foundAutonomy := node.Annotations[constants.AnnotationAutonomy]
-			if foundAutonomy {
-				delete(node.Annotations, constants.AnnotationAutonomy)
+	for _, step := range steps {
+		// a dry run neither reads nor creates the resume-state ConfigMap
+		// (reading it creates it when missing), so resume state is only
+		// consulted for a real run.
+		if !ro.DryRun {
+			done, stateErr := isStepComplete(ro.clientSet, step.Name())
+			if stateErr != nil {
+				klog.Errorf("fail to read resume state for step %q: %s", step.Name(), stateErr)
+			} else if done && ro.ResumeFrom != "" {
+				klog.Infof("step %q already completed, skipping", step.Name())
+				continue
 			}
 		}
-		if ok {
-			// remove the label for both the cloud node and the edge node
-			delete(node.Labels, projectinfo.GetEdgeWorkerLabelKey())
-			if _, err = ro.clientSet.CoreV1().Nodes().Update(&node); err != nil {
-				return
+
+		if err = step.PreCheck(ro); err != nil {
+			klog.Errorf("step %q failed pre-check: %s", step.Name(), err)
+			if rollbackErr := step.Rollback(ro); rollbackErr != nil {
+				klog.Errorf("step %q rollback failed: %s", step.Name(), rollbackErr)
+			}
+			return fmt.Errorf("revert step %q failed pre-check: %s", step.Name(), err)
+		}
+		if err = step.Execute(ro); err != nil {
+			klog.Errorf("step %q failed: %s", step.Name(), err)
+			if rollbackErr := step.Rollback(ro); rollbackErr != nil {
+				klog.Errorf("step %q rollback failed: %s", step.Name(), rollbackErr)
+			}
+			return fmt.Errorf("revert step %q failed, re-run with --resume-from=%s after fixing the issue: %s",
+				step.Name(), step.Name(), err)
+		}
+		if !ro.DryRun {
+			if stateErr := markStepComplete(ro.clientSet, step.Name()); stateErr != nil {
+				klog.Errorf("fail to persist resume state for step %q: %s", step.Name(), stateErr)
 			}
 		}
 	}
-	klog.Info("label alibabacloud.com/is-edge-worker is removed")
-
-	// 3. remove the yurt controller manager
-	if err = ro.clientSet.AppsV1().Deployments("kube-system").
-		Delete("yurt-controller-manager", &metav1.DeleteOptions{
-			PropagationPolicy: &kubeutil.PropagationPolicy,
-		}); err != nil && !apierrors.IsNotFound(err) {
-		klog.Errorf("fail to remove yurt controller manager: %s", err)
-		return
-	}
-	klog.Info("yurt controller manager is removed")
-
-	// 5. remove the yurt-tunnel agent
-	if err = removeYurtTunnelAgent(ro.clientSet); err != nil {
-		klog.Errorf("fail to remove the yurt tunnel agent: %s", err)
-		return
-	}
-
-	// 6. remove the yurt-tunnel server
-	if err = removeYurtTunnelServer(ro.clientSet); err != nil {
-		klog.Errorf("fail to remove the yurt tunnel server: %s", err)
-		return
-	}
-
-	// 7. recreate the node-controller service account
-	ncSa := &v1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "node-controller",
-			Namespace: "kube-system",
-		},
-	}
-	if _, err = ro.clientSet.CoreV1().
-		ServiceAccounts(ncSa.GetNamespace()).Create(ncSa); err != nil && !apierrors.IsAlreadyExists(err) {
-		klog.Errorf("fail to create node-controller service account: %s", err)
-		return
-	}
-	klog.Info("ServiceAccount node-controller is created")
 
-	// 8. remove yurt-hub and revert kubelet service
-	if err = kubeutil.RunServantJobs(ro.clientSet,
-		map[string]string{
-			"action":                "revert",
-			"yurtctl_servant_image": ro.YurtctlServantImage,
-		},
-		edgeNodeNames); err != nil {
-		klog.Errorf("fail to revert edge node: %s", err)
-		return
+	if !ro.DryRun {
+		if err := clearRevertState(ro.clientSet); err != nil {
+			klog.Error(err)
+		}
 	}
-	klog.Info("yurt-hub is removed, kubelet service is reset")
-	return
+	return nil
 }
 
-func removeYurtTunnelServer(client *kubernetes.Clientset) error {
+func removeYurtTunnelServer(ro *RevertOptions) error {
+	client := ro.clientSet
+
 	// 1. remove the DaemonSet
-	if err := client.AppsV1().
-		DaemonSets(constants.YurttunnelNamespace).
-		Delete(constants.YurttunnelServerComponentName,
-			&metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+	if err := ro.mutate(func() error {
+		return client.AppsV1().
+			DaemonSets(constants.YurttunnelNamespace).
+			Delete(constants.YurttunnelServerComponentName, &metav1.DeleteOptions{})
+	}); err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("fail to delete the daemonset/%s: %s",
 			constants.YurttunnelServerComponentName, err)
 	}
 	klog.V(4).Infof("daemonset/%s is deleted", constants.YurttunnelServerComponentName)
 
 	// 2. remove the Service
-	if err := client.CoreV1().Services(constants.YurttunnelNamespace).
-		Delete(constants.YurttunnelServerSvcName,
-			&metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+	if err := ro.mutate(func() error {
+		return client.CoreV1().Services(constants.YurttunnelNamespace).
+			Delete(constants.YurttunnelServerSvcName, &metav1.DeleteOptions{})
+	}); err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("fail to delete the service/%s: %s",
 			constants.YurttunnelServerSvcName, err)
 	}
 	klog.V(4).Infof("service/%s is deleted", constants.YurttunnelServerSvcName)
 
 	// 3. remove the ClusterRoleBinding
-	if err := client.RbacV1().ClusterRoleBindings().
-		Delete(constants.YurttunnelServerComponentName,
-			&metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+	if err := ro.mutate(func() error {
+		return client.RbacV1().ClusterRoleBindings().
+			Delete(constants.YurttunnelServerComponentName, &metav1.DeleteOptions{})
+	}); err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("fail to delete the clusterrolebinding/%s: %s",
 			constants.YurttunnelServerComponentName, err)
 	}
 	klog.V(4).Infof("clusterrolebinding/%s is deleted", constants.YurttunnelServerComponentName)
 
 	// 4. remove the SerivceAccount
-	if err := client.CoreV1().ServiceAccounts(constants.YurttunnelNamespace).
-		Delete(constants.YurttunnelServerComponentName,
-			&metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+	if err := ro.mutate(func() error {
+		return client.CoreV1().ServiceAccounts(constants.YurttunnelNamespace).
+			Delete(constants.YurttunnelServerComponentName, &metav1.DeleteOptions{})
+	}); err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("fail to delete the serviceaccount/%s: %s",
 			constants.YurttunnelServerComponentName, err)
 	}
 	klog.V(4).Infof("serviceaccount/%s is deleted", constants.YurttunnelServerComponentName)
 
 	// 5. remove the ClusterRole
-	if err := client.RbacV1().ClusterRoles().
-		Delete(constants.YurttunnelServerComponentName,
-			&metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+	if err := ro.mutate(func() error {
+		return client.RbacV1().ClusterRoles().
+			Delete(constants.YurttunnelServerComponentName, &metav1.DeleteOptions{})
+	}); err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("fail to delete the clusterrole/%s: %s",
 			constants.YurttunnelServerComponentName, err)
 	}
@@ -227,30 +384,35 @@ func removeYurtTunnelServer(client *kubernetes.Clientset) error {
 	return nil
 }
 
-func removeYurtTunnelAgent(client *kubernetes.Clientset) error {
+func removeYurtTunnelAgent(ro *RevertOptions) error {
+	client := ro.clientSet
+
 	// 1. remove the DaemonSet
-	if err := client.AppsV1().
-		DaemonSets(constants.YurttunnelNamespace).
-		Delete(constants.YurttunnelAgentComponentName,
-			&metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+	if err := ro.mutate(func() error {
+		return client.AppsV1().
+			DaemonSets(constants.YurttunnelNamespace).
+			Delete(constants.YurttunnelAgentComponentName, &metav1.DeleteOptions{})
+	}); err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("fail to delete the daemonset/%s: %s",
 			constants.YurttunnelAgentComponentName, err)
 	}
 	klog.V(4).Infof("daemonset/%s is deleted", constants.YurttunnelAgentComponentName)
 
 	// 2. remove the ClusterRoleBinding
-	if err := client.RbacV1().ClusterRoleBindings().
-		Delete(constants.YurttunnelAgentComponentName,
-			&metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+	if err := ro.mutate(func() error {
+		return client.RbacV1().ClusterRoleBindings().
+			Delete(constants.YurttunnelAgentComponentName, &metav1.DeleteOptions{})
+	}); err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("fail to delete the clusterrolebinding/%s: %s",
 			constants.YurttunnelAgentComponentName, err)
 	}
 	klog.V(4).Infof("clusterrolebinding/%s is deleted", constants.YurttunnelAgentComponentName)
 
 	// 3. remove the ClusterRole
-	if err := client.RbacV1().ClusterRoles().
-		Delete(constants.YurttunnelAgentComponentName,
-			&metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+	if err := ro.mutate(func() error {
+		return client.RbacV1().ClusterRoles().
+			Delete(constants.YurttunnelAgentComponentName, &metav1.DeleteOptions{})
+	}); err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("fail to delete the clusterrole/%s: %s",
 			constants.YurttunnelAgentComponentName, err)
 	}
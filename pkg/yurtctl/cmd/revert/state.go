@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revert
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// revertStateConfigMapName is the well-known ConfigMap used to persist
+	// which revert steps have already completed, so that `yurtctl revert`
+	// can be re-run with --resume-from after a partial failure without
+	// repeating completed work.
+	revertStateConfigMapName = "yurtctl-revert-state"
+	// revertStateNamespace is the namespace the state ConfigMap lives in.
+	revertStateNamespace = "kube-system"
+	// revertStepAnnotationPrefix is prepended to a step's Name() to form
+	// the annotation key that records its completion.
+	revertStepAnnotationPrefix = "revert.openyurt.io/step-"
+)
+
+// getOrCreateRevertStateConfigMap fetches the ConfigMap used to track
+// resume state, creating it if it does not yet exist.
+func getOrCreateRevertStateConfigMap(clientSet kubernetes.Interface) (*v1.ConfigMap, error) {
+	cm, err := clientSet.CoreV1().ConfigMaps(revertStateNamespace).
+		Get(revertStateConfigMapName, metav1.GetOptions{})
+	if err == nil {
+		return cm, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	cm = &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      revertStateConfigMapName,
+			Namespace: revertStateNamespace,
+		},
+	}
+	return clientSet.CoreV1().ConfigMaps(revertStateNamespace).Create(cm)
+}
+
+// isStepComplete reports whether a step was already marked as completed by
+// a previous `yurtctl revert` invocation.
+func isStepComplete(clientSet kubernetes.Interface, stepName string) (bool, error) {
+	cm, err := getOrCreateRevertStateConfigMap(clientSet)
+	if err != nil {
+		return false, err
+	}
+	_, done := cm.Annotations[revertStepAnnotationPrefix+stepName]
+	return done, nil
+}
+
+// markStepComplete records that a step finished successfully so a later
+// resumed run can skip it.
+func markStepComplete(clientSet kubernetes.Interface, stepName string) error {
+	cm, err := getOrCreateRevertStateConfigMap(clientSet)
+	if err != nil {
+		return err
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[revertStepAnnotationPrefix+stepName] = "completed"
+	_, err = clientSet.CoreV1().ConfigMaps(revertStateNamespace).Update(cm)
+	return err
+}
+
+// clearRevertState removes the state ConfigMap once the revert flow
+// finishes successfully end to end, so a future revert starts clean.
+func clearRevertState(clientSet kubernetes.Interface) error {
+	err := clientSet.CoreV1().ConfigMaps(revertStateNamespace).
+		Delete(revertStateConfigMapName, &metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("fail to clean up revert state configmap/%s: %s", revertStateConfigMapName, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revert
+
+import (
+	"fmt"
+)
+
+// RevertStep is a single, named unit of work performed while reverting a
+// yurt cluster back to a standard Kubernetes cluster. Steps are executed in
+// the order they are registered. Out-of-tree components (e.g.
+// yurt-app-manager) can append their own cleanup steps by calling
+// RegisterStep from an init function.
+type RevertStep interface {
+	// Name returns the unique, stable identifier of the step. It is used
+	// on the command line (--skip, --only, --resume-from) and persisted
+	// as part of the resume state, so it must never change once released.
+	Name() string
+	// PreCheck validates that the step can run against the current
+	// cluster state. It must not mutate anything.
+	PreCheck(ro *RevertOptions) error
+	// Execute performs the step's mutation. When ro.DryRun is true it
+	// must only report what it would do and must not change anything
+	// through the API server; it may still read cluster state.
+	Execute(ro *RevertOptions) error
+	// Rollback undoes what the step applied before it failed. It is
+	// called only for the step whose PreCheck or Execute failed; steps
+	// that completed earlier are not rolled back. It is best effort: its
+	// own errors are logged, not propagated.
+	Rollback(ro *RevertOptions) error
+}
+
+// stepRegistry holds the ordered set of steps that make up the revert flow.
+// It is populated by RegisterStep, normally from an init function (the
+// built-in steps are registered by the init in steps.go), so registration
+// order doubles as the execution order.
+var stepRegistry []RevertStep
+
+// RegisterStep appends a step to the registry. It panics on a duplicate
+// name since that indicates a programming error rather than a runtime
+// condition callers can reasonably recover from.
+func RegisterStep(step RevertStep) {
+	for _, s := range stepRegistry {
+		if s.Name() == step.Name() {
+			panic(fmt.Sprintf("revert step %q is already registered", step.Name()))
+		}
+	}
+	stepRegistry = append(stepRegistry, step)
+}
+
+// RegisteredSteps returns the steps currently registered, in execution
+// order. The returned slice is a copy so callers may filter it freely.
+func RegisteredSteps() []RevertStep {
+	steps := make([]RevertStep, len(stepRegistry))
+	copy(steps, stepRegistry)
+	return steps
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package revert
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/alibaba/openyurt/pkg/projectinfo"
+	"github.com/alibaba/openyurt/pkg/yurtctl/constants"
+	kubeutil "github.com/alibaba/openyurt/pkg/yurtctl/util/kubernetes"
+)
+
+func init() {
+	RegisterStep(&removeEdgeLabelStep{})
+	RegisterStep(&removeControllerManagerStep{})
+	RegisterStep(&removeTunnelAgentStep{})
+	RegisterStep(&removeTunnelServerStep{})
+	RegisterStep(&recreateNodeControllerSAStep{})
+	RegisterStep(&servantJobStep{})
+}
+
+// removeEdgeLabelStep strips the edge-worker label (and the autonomy
+// annotation) that yurtctl convert added to every node.
+type removeEdgeLabelStep struct {
+	// edgeNodeNames is populated by Execute and consumed by later steps
+	// that only need to run their servant job against edge nodes.
+	edgeNodeNames []string
+}
+
+func (s *removeEdgeLabelStep) Name() string { return "remove-edge-label" }
+
+func (s *removeEdgeLabelStep) PreCheck(ro *RevertOptions) error {
+	return nil
+}
+
+func (s *removeEdgeLabelStep) Execute(ro *RevertOptions) error {
+	nodeLst, err := ro.clientSet.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodeLst.Items {
+		isEdgeNode, ok := node.Labels[projectinfo.GetEdgeWorkerLabelKey()]
+		if ok && isEdgeNode == "true" {
+			// cache edge nodes, we need to run servant job on each edge node later
+			s.edgeNodeNames = append(s.edgeNodeNames, node.GetName())
+		}
+		if !ok {
+			continue
+		}
+		if ro.DryRun {
+			klog.Infof("[dry-run] would remove label %s and annotation %s from node/%s",
+				projectinfo.GetEdgeWorkerLabelKey(), constants.AnnotationAutonomy, node.GetName())
+			continue
+		}
+		// remove the label and the autonomy annotation (if present) for
+		// both the cloud node and the edge node, in the same mutation so
+		// neither edit is lost to the other's conflict-retry
+		nodeName := node.GetName()
+		if err := ro.mutateNode(nodeName, func(n *v1.Node) {
+			delete(n.Labels, projectinfo.GetEdgeWorkerLabelKey())
+			delete(n.Annotations, constants.AnnotationAutonomy)
+		}); err != nil {
+			return err
+		}
+	}
+	ro.edgeNodeNames = s.edgeNodeNames
+	if ro.DryRun {
+		return nil
+	}
+	klog.Info("label alibabacloud.com/is-edge-worker is removed")
+	return nil
+}
+
+func (s *removeEdgeLabelStep) Rollback(ro *RevertOptions) error {
+	for _, name := range s.edgeNodeNames {
+		err := ro.mutateNode(name, func(n *v1.Node) {
+			if n.Labels == nil {
+				n.Labels = map[string]string{}
+			}
+			n.Labels[projectinfo.GetEdgeWorkerLabelKey()] = "true"
+		})
+		if err != nil {
+			klog.Errorf("fail to rollback label on node/%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// removeControllerManagerStep deletes the yurt-controller-manager Deployment.
+type removeControllerManagerStep struct{}
+
+func (s *removeControllerManagerStep) Name() string { return "remove-controller-manager" }
+
+func (s *removeControllerManagerStep) PreCheck(ro *RevertOptions) error { return nil }
+
+func (s *removeControllerManagerStep) Execute(ro *RevertOptions) error {
+	if ro.DryRun {
+		klog.Info("[dry-run] would delete deployment/yurt-controller-manager")
+		return nil
+	}
+	if err := ro.mutate(func() error {
+		return ro.clientSet.AppsV1().Deployments("kube-system").
+			Delete("yurt-controller-manager", &metav1.DeleteOptions{
+				PropagationPolicy: &kubeutil.PropagationPolicy,
+			})
+	}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("fail to remove yurt controller manager: %s", err)
+	}
+	klog.Info("yurt controller manager is removed")
+	return nil
+}
+
+func (s *removeControllerManagerStep) Rollback(ro *RevertOptions) error {
+	klog.Warning("rollback is not supported for step remove-controller-manager: " +
+		"the deployment must be reinstalled by re-running yurtctl convert")
+	return nil
+}
+
+// removeTunnelAgentStep tears down the yurt-tunnel-agent DaemonSet and RBAC.
+type removeTunnelAgentStep struct{}
+
+func (s *removeTunnelAgentStep) Name() string { return "remove-tunnel-agent" }
+
+func (s *removeTunnelAgentStep) PreCheck(ro *RevertOptions) error { return nil }
+
+func (s *removeTunnelAgentStep) Execute(ro *RevertOptions) error {
+	if ro.DryRun {
+		klog.Info("[dry-run] would remove the yurt-tunnel-agent daemonset and RBAC")
+		return nil
+	}
+	if err := removeYurtTunnelAgent(ro); err != nil {
+		return fmt.Errorf("fail to remove the yurt tunnel agent: %s", err)
+	}
+	return nil
+}
+
+func (s *removeTunnelAgentStep) Rollback(ro *RevertOptions) error {
+	klog.Warning("rollback is not supported for step remove-tunnel-agent: " +
+		"the agent must be reinstalled by re-running yurtctl convert")
+	return nil
+}
+
+// removeTunnelServerStep tears down the yurt-tunnel-server DaemonSet and RBAC.
+type removeTunnelServerStep struct{}
+
+func (s *removeTunnelServerStep) Name() string { return "remove-tunnel-server" }
+
+func (s *removeTunnelServerStep) PreCheck(ro *RevertOptions) error { return nil }
+
+func (s *removeTunnelServerStep) Execute(ro *RevertOptions) error {
+	if ro.DryRun {
+		klog.Info("[dry-run] would remove the yurt-tunnel-server daemonset and RBAC")
+		return nil
+	}
+	if err := removeYurtTunnelServer(ro); err != nil {
+		return fmt.Errorf("fail to remove the yurt tunnel server: %s", err)
+	}
+	return nil
+}
+
+func (s *removeTunnelServerStep) Rollback(ro *RevertOptions) error {
+	klog.Warning("rollback is not supported for step remove-tunnel-server: " +
+		"the server must be reinstalled by re-running yurtctl convert")
+	return nil
+}
+
+// recreateNodeControllerSAStep recreates the node-controller ServiceAccount
+// that yurtctl convert removes.
+type recreateNodeControllerSAStep struct{}
+
+func (s *recreateNodeControllerSAStep) Name() string { return "recreate-node-controller-sa" }
+
+func (s *recreateNodeControllerSAStep) PreCheck(ro *RevertOptions) error { return nil }
+
+func (s *recreateNodeControllerSAStep) Execute(ro *RevertOptions) error {
+	if ro.DryRun {
+		klog.Info("[dry-run] would create serviceaccount/node-controller in kube-system")
+		return nil
+	}
+	ncSa := &v1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "node-controller",
+			Namespace: "kube-system",
+		},
+	}
+	if err := ro.mutate(func() error {
+		_, err := ro.clientSet.CoreV1().ServiceAccounts(ncSa.GetNamespace()).Create(ncSa)
+		return err
+	}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("fail to create node-controller service account: %s", err)
+	}
+	klog.Info("ServiceAccount node-controller is created")
+	return nil
+}
+
+func (s *recreateNodeControllerSAStep) Rollback(ro *RevertOptions) error {
+	if err := ro.mutate(func() error {
+		return ro.clientSet.CoreV1().ServiceAccounts("kube-system").
+			Delete("node-controller", &metav1.DeleteOptions{})
+	}); err != nil && !apierrors.IsNotFound(err) {
+		klog.Errorf("fail to rollback step recreate-node-controller-sa: %s", err)
+	}
+	return nil
+}
+
+// servantJobStep runs the yurtctl-servant job on every edge node to remove
+// yurt-hub and reset the kubelet service back to talking to the apiserver
+// directly.
+type servantJobStep struct{}
+
+func (s *servantJobStep) Name() string { return "run-servant-job" }
+
+func (s *servantJobStep) PreCheck(ro *RevertOptions) error { return nil }
+
+func (s *servantJobStep) Execute(ro *RevertOptions) error {
+	if ro.DryRun {
+		klog.Infof("[dry-run] would run the revert servant job on edge nodes: %v", ro.edgeNodeNames)
+		return nil
+	}
+
+	if !ro.DrainEdgeNodes {
+		if err := ro.mutate(func() error {
+			return kubeutil.RunServantJobs(ro.clientSet,
+				map[string]string{
+					"action":                "revert",
+					"yurtctl_servant_image": ro.YurtctlServantImage,
+				},
+				ro.edgeNodeNames)
+		}); err != nil {
+			return fmt.Errorf("fail to revert edge node: %s", err)
+		}
+		klog.Info("yurt-hub is removed, kubelet service is reset")
+		return nil
+	}
+
+	// cordoned tracks nodes that are currently cordoned by this run, so a
+	// failure partway through can uncordon everything it touched instead
+	// of leaving the cluster half-drained.
+	var cordoned []string
+	rollbackCordons := func() {
+		for _, name := range cordoned {
+			if err := uncordonNode(ro, name); err != nil {
+				klog.Errorf("fail to uncordon node/%s during rollback: %s", name, err)
+			}
+		}
+	}
+
+	for _, nodeName := range ro.edgeNodeNames {
+		if err := cordonNode(ro, nodeName); err != nil {
+			rollbackCordons()
+			return fmt.Errorf("fail to cordon node/%s: %s", nodeName, err)
+		}
+		cordoned = append(cordoned, nodeName)
+		recordNodeEvent(ro, nodeName, "RevertDrainStarted", "cordoned the node ahead of yurt-hub removal")
+
+		// one deadline covers eviction and waitForPodsGone together, so
+		// the whole drain fits in a single --drain-timeout budget rather
+		// than a fresh one for each phase
+		drainDeadline := time.Now().Add(ro.DrainTimeout)
+		if err := evictNodePods(ro, nodeName, drainDeadline); err != nil {
+			recordNodeEvent(ro, nodeName, "RevertDrainFailed", err.Error())
+			rollbackCordons()
+			return err
+		}
+		if err := waitForPodsGone(ro, nodeName, drainDeadline); err != nil {
+			recordNodeEvent(ro, nodeName, "RevertDrainFailed",
+				fmt.Sprintf("timed out waiting for pods to be evicted: %s", err))
+			rollbackCordons()
+			return fmt.Errorf("fail to drain node/%s: %s", nodeName, err)
+		}
+		recordNodeEvent(ro, nodeName, "RevertDrainCompleted", "all non-daemonset pods evicted")
+
+		if err := ro.mutate(func() error {
+			return kubeutil.RunServantJobs(ro.clientSet,
+				map[string]string{
+					"action":                "revert",
+					"yurtctl_servant_image": ro.YurtctlServantImage,
+				},
+				[]string{nodeName})
+		}); err != nil {
+			recordNodeEvent(ro, nodeName, "RevertYurtHubRemovalFailed", err.Error())
+			rollbackCordons()
+			return fmt.Errorf("fail to revert edge node/%s: %s", nodeName, err)
+		}
+		recordNodeEvent(ro, nodeName, "RevertYurtHubRemoved", "yurt-hub removed, kubelet service reset")
+
+		if err := uncordonNode(ro, nodeName); err != nil {
+			return fmt.Errorf("fail to uncordon node/%s: %s", nodeName, err)
+		}
+		recordNodeEvent(ro, nodeName, "RevertUncordoned", "node uncordoned after revert")
+		cordoned = cordoned[:len(cordoned)-1]
+	}
+
+	klog.Info("yurt-hub is removed, kubelet service is reset")
+	return nil
+}
+
+func (s *servantJobStep) Rollback(ro *RevertOptions) error {
+	klog.Warning("rollback is not supported for step run-servant-job: " +
+		"edge nodes must be re-converted by re-running yurtctl convert")
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package retry wraps the one-shot client-go mutations that yurtctl issues
+// against the API server with exponential backoff, so a transient 429,
+// 5xx, connection reset, or an optimistic-concurrency conflict does not
+// abort an operation like revert half-done.
+package retry
+
+import (
+	"context"
+	"net"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+
+	"k8s.io/api/core/v1"
+)
+
+// DefaultBackoff is the default backoff schedule used to retry a mutating
+// call against the API server: 500ms initial, doubling every attempt,
+// with 10% jitter, capped at 30s between attempts.
+var DefaultBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.1,
+	Steps:    30,
+	Cap:      30 * time.Second,
+}
+
+// IsRetryable reports whether err is a transient condition worth retrying:
+// a server timeout, a rate limit (429), an internal server error, or a
+// network-level failure such as a connection reset.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if apierrors.IsServerTimeout(err) || apierrors.IsTooManyRequests(err) || apierrors.IsInternalError(err) {
+		return true
+	}
+	if netErr, ok := err.(net.Error); ok {
+		return netErr.Temporary() || netErr.Timeout()
+	}
+	return false
+}
+
+// OnError retries fn using backoff for as long as the error it returns is
+// retriable(err) or IsRetryable(err). It returns the last error seen once
+// the backoff is exhausted, or nil on success.
+func OnError(backoff wait.Backoff, retriable func(error) bool, fn func() error) error {
+	return OnErrorWithTimeout(0, backoff, retriable, fn)
+}
+
+// OnErrorWithTimeout behaves like OnError but additionally bounds the
+// total time spent retrying to timeout (zero means no bound), so a
+// misbehaving apiserver cannot make a caller hang indefinitely.
+func OnErrorWithTimeout(timeout time.Duration, backoff wait.Backoff, retriable func(error) bool, fn func() error) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func() (bool, error) {
+		err := fn()
+		switch {
+		case err == nil:
+			return true, nil
+		case retriable(err) || IsRetryable(err):
+			klog.V(4).Infof("retrying after transient error: %s", err)
+			lastErr = err
+			return false, nil
+		default:
+			return false, err
+		}
+	})
+	if err == wait.ErrWaitTimeout || err == context.DeadlineExceeded {
+		if lastErr != nil {
+			return lastErr
+		}
+		return err
+	}
+	return err
+}
+
+// Mutate retries fn with DefaultBackoff for any IsRetryable error. It is
+// the helper of choice for one-shot Delete/Create/Update calls that don't
+// need conflict handling.
+func Mutate(fn func() error) error {
+	return OnError(DefaultBackoff, func(error) bool { return false }, fn)
+}
+
+// UpdateNode retries a Node update in the face of optimistic-concurrency
+// conflicts: on every attempt it re-GETs the node, applies modify to the
+// freshly fetched object, and re-issues the Update, so a conflict caused
+// by a concurrent writer doesn't need the caller to re-run from scratch.
+func UpdateNode(clientSet kubernetes.Interface, name string, modify func(*v1.Node)) error {
+	return OnError(DefaultBackoff, apierrors.IsConflict, func() error {
+		node, err := clientSet.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		modify(node)
+		_, err = clientSet.CoreV1().Nodes().Update(node)
+		return err
+	})
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package iptables programs the DNAT rule that lets the local interceptor
+// reach whichever node is currently running the yurttunnel-agent the
+// apiserver is proxying through.
+package iptables
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1beta1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1beta1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	"github.com/alibaba/openyurt/pkg/yurttunnel/constants"
+	"github.com/alibaba/openyurt/pkg/yurttunnel/projectinfo"
+	"github.com/alibaba/openyurt/pkg/yurttunnel/server/metrics"
+)
+
+// dnatChain is the dedicated iptables chain this manager owns. It is
+// jumped to from the nat table's OUTPUT chain and rewritten wholesale on
+// every sync, so a sync never has to reason about rules it didn't write.
+const dnatChain = "YURTTUNNEL-DNAT"
+
+// IptablesManager reconciles the DNAT rule that routes traffic destined
+// for the tunnel-server's local interceptor to the current set of
+// yurttunnel-agent endpoints.
+//
+// Reconciliation used to run strictly on a fixed --iptables-sync-period
+// timer, rebuilding every rule on every tick whether or not anything had
+// actually changed. It is now event-driven: the manager is handed the
+// server's shared informer factory and reacts to a Node's InternalIP or
+// edge-worker label changing, or an agent connecting/disconnecting from
+// the yurttunnel-agent EndpointSlice. The sync period is kept only as a
+// periodic safety resync, not the primary trigger.
+type IptablesManager struct {
+	clientset  kubernetes.Interface
+	bindAddr   string
+	syncPeriod time.Duration
+	stopCh     <-chan struct{}
+
+	epsLister discoverylisters.EndpointSliceLister
+
+	// mu serializes rule programming: informer callbacks and the
+	// periodic resync must not race each other. It also guards
+	// lastAgentNodes.
+	mu sync.Mutex
+	// lastAgentNodes is the set of node names the previous sync reported
+	// to metrics.AgentsConnected, so a node that disappears from the
+	// EndpointSlice entirely (rather than just going not-ready) can be
+	// reset back to 0 instead of being left stuck at its last value.
+	lastAgentNodes map[string]bool
+}
+
+// NewIptablesManager creates an IptablesManager and wires it up to the
+// Node and tunnel-agent EndpointSlice informers obtained from
+// informerFactory. informerFactory is expected to already be shared with
+// the rest of the server (e.g. the CSR approver) so the process holds a
+// single watch connection per resource instead of one per subsystem.
+func NewIptablesManager(
+	clientset kubernetes.Interface,
+	informerFactory informers.SharedInformerFactory,
+	bindAddr string,
+	iptablesSyncPeriod int,
+	stopCh <-chan struct{},
+) *IptablesManager {
+	if clientset == nil || informerFactory == nil {
+		return nil
+	}
+
+	im := &IptablesManager{
+		clientset:      clientset,
+		bindAddr:       bindAddr,
+		syncPeriod:     time.Duration(iptablesSyncPeriod) * time.Second,
+		stopCh:         stopCh,
+		epsLister:      informerFactory.Discovery().V1beta1().EndpointSlices().Lister(),
+		lastAgentNodes: map[string]bool{},
+	}
+
+	nodeInformer := informerFactory.Core().V1().Nodes().Informer()
+	nodeInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			im.syncIptableRules("node added")
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			im.onNodeUpdate(oldObj, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			im.syncIptableRules("node deleted")
+		},
+	})
+
+	epsInformer := informerFactory.Discovery().V1beta1().EndpointSlices().Informer()
+	epsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			im.syncIfTunnelAgentEndpointSlice(obj, "agent endpointslice added")
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			im.syncIfTunnelAgentEndpointSlice(newObj, "agent endpointslice updated")
+		},
+		DeleteFunc: func(obj interface{}) {
+			im.syncIfTunnelAgentEndpointSlice(obj, "agent endpointslice deleted")
+		},
+	})
+
+	return im
+}
+
+// Run starts the periodic safety resync in its own goroutine and returns
+// immediately; it does not wait for the informer caches to sync.
+func (im *IptablesManager) Run() {
+	go wait.Until(func() {
+		im.syncIptableRules("periodic resync")
+	}, im.syncPeriod, im.stopCh)
+}
+
+func (im *IptablesManager) onNodeUpdate(oldObj, newObj interface{}) {
+	oldNode, ok := oldObj.(*v1.Node)
+	if !ok {
+		return
+	}
+	newNode, ok := newObj.(*v1.Node)
+	if !ok {
+		return
+	}
+	if nodeInternalIP(oldNode) == nodeInternalIP(newNode) &&
+		oldNode.Labels[projectinfo.GetEdgeWorkerLabelKey()] == newNode.Labels[projectinfo.GetEdgeWorkerLabelKey()] {
+		// nothing this manager cares about changed
+		return
+	}
+	im.syncIptableRules("node InternalIP/edge-worker label changed")
+}
+
+func (im *IptablesManager) syncIfTunnelAgentEndpointSlice(obj interface{}, reason string) {
+	eps, ok := obj.(*discovery.EndpointSlice)
+	if !ok {
+		return
+	}
+	if eps.Labels[discovery.LabelServiceName] != constants.YurttunnelServerAgentSvcName {
+		return
+	}
+	im.syncIptableRules(reason)
+}
+
+// syncIptableRules rebuilds the DNAT rule against the current set of
+// yurttunnel-agent endpoints. It is serialized by mu so an informer
+// callback and the periodic resync never program rules concurrently.
+func (im *IptablesManager) syncIptableRules(reason string) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	klog.V(2).Infof("syncing iptables DNAT rule: %s", reason)
+
+	start := time.Now()
+	metrics.IptablesSyncTotal.Inc()
+	var err error
+	defer func() {
+		metrics.IptablesSyncDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.IptablesSyncFailuresTotal.Inc()
+		}
+	}()
+
+	target, ok, err := im.currentAgentAddr()
+	if err != nil {
+		klog.Errorf("fail to determine the current %s address: %v",
+			projectinfo.GetAgentName(), err)
+		return
+	}
+	if !ok {
+		klog.V(2).Infof("no connected %s found, clearing the DNAT rule",
+			projectinfo.GetAgentName())
+		target = ""
+	}
+
+	if err = im.restoreRules(target); err != nil {
+		klog.Errorf("fail to program the tunnel DNAT rule: %v", err)
+	}
+}
+
+// currentAgentAddr returns the address of a ready endpoint in the
+// yurttunnel-agent Service's EndpointSlices, i.e. a node that currently
+// has a connected agent. It returns ok=false, with no error, if the
+// Service has no ready endpoints at all (e.g. every edge node is
+// currently disconnected). As a side effect it refreshes
+// metrics.AgentsConnected for every node the Service currently
+// references.
+func (im *IptablesManager) currentAgentAddr() (string, bool, error) {
+	slices, err := im.epsLister.List(labels.Everything())
+	if err != nil {
+		return "", false, fmt.Errorf("fail to list endpointslices: %v", err)
+	}
+
+	target, found := "", false
+	seenNodes := map[string]bool{}
+	for _, eps := range slices {
+		if eps.Labels[discovery.LabelServiceName] != constants.YurttunnelServerAgentSvcName {
+			continue
+		}
+		for _, ep := range eps.Endpoints {
+			nodeName := endpointNodeName(ep)
+			if nodeName == "" {
+				continue
+			}
+			ready := ep.Conditions.Ready == nil || *ep.Conditions.Ready
+			seenNodes[nodeName] = true
+			if ready {
+				metrics.AgentsConnected.WithLabelValues(nodeName).Set(1)
+			} else {
+				metrics.AgentsConnected.WithLabelValues(nodeName).Set(0)
+			}
+			if ready && !found && len(ep.Addresses) > 0 {
+				target, found = ep.Addresses[0], true
+			}
+		}
+	}
+	for nodeName := range im.lastAgentNodes {
+		if !seenNodes[nodeName] {
+			metrics.AgentsConnected.WithLabelValues(nodeName).Set(0)
+		}
+	}
+	im.lastAgentNodes = seenNodes
+
+	return target, found, nil
+}
+
+func endpointNodeName(ep discovery.Endpoint) string {
+	if ep.NodeName != nil {
+		return *ep.NodeName
+	}
+	return ep.Topology["kubernetes.io/hostname"]
+}
+
+// restoreRules rewrites dnatChain wholesale via iptables-restore. When
+// target is empty the chain is left empty, i.e. any existing DNAT rule is
+// removed. Otherwise traffic destined for bindAddr is DNAT'ed to target,
+// so the local interceptor can reach whichever node currently has a
+// connected yurttunnel-agent.
+func (im *IptablesManager) restoreRules(target string) error {
+	var rules bytes.Buffer
+	fmt.Fprintln(&rules, "*nat")
+	fmt.Fprintf(&rules, ":%s - [0:0]\n", dnatChain)
+	fmt.Fprintf(&rules, "-A OUTPUT -d %s -j %s\n", im.bindAddr, dnatChain)
+	if target != "" {
+		fmt.Fprintf(&rules, "-A %s -j DNAT --to-destination %s\n", dnatChain, target)
+	}
+	fmt.Fprintln(&rules, "COMMIT")
+
+	cmd := exec.Command("iptables-restore", "--noflush")
+	cmd.Stdin = &rules
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("iptables-restore failed: %v: %s", err, stderr.String())
+	}
+	return nil
+}
+
+func nodeInternalIP(node *v1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+	return ""
+}
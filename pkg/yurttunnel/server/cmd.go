@@ -18,11 +18,14 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog"
 
@@ -32,6 +35,7 @@ import (
 	"github.com/alibaba/openyurt/pkg/yurttunnel/pki"
 	"github.com/alibaba/openyurt/pkg/yurttunnel/pki/certmanager"
 	"github.com/alibaba/openyurt/pkg/yurttunnel/projectinfo"
+	"github.com/alibaba/openyurt/pkg/yurttunnel/server/metrics"
 )
 
 // NewYurttunnelServerCommand creates a new yurttunnel-server command
@@ -73,6 +77,12 @@ func NewYurttunnelServerCommand(stopCh <-chan struct{}) *cobra.Command {
 	flags.IntVar(&o.iptablesSyncPeriod, "iptables-sync-period",
 		o.iptablesSyncPeriod,
 		"the synchronization period of the iptable manager.")
+	flags.StringVar(&o.metricsBindAddr, "metrics-bind-address",
+		o.metricsBindAddr,
+		"the address on which to serve the /metrics endpoint.")
+	flags.StringVar(&o.healthBindAddr, "health-bind-address",
+		o.healthBindAddr,
+		"the address on which to serve the /healthz and /readyz endpoints.")
 	return cmd
 }
 
@@ -89,7 +99,12 @@ type YurttunnelServerOptions struct {
 	interceptorServerUDSFile string
 	serverAgentAddr          string
 	serverMasterAddr         string
+	metricsBindAddr          string
+	healthBindAddr           string
 	clientset                kubernetes.Interface
+	// sharedInformerFactory backs the iptables manager's Node and
+	// EndpointSlice watches.
+	sharedInformerFactory informers.SharedInformerFactory
 }
 
 // NewYurttunnelServerOptions creates a new YurtNewYurttunnelServerOptions
@@ -101,6 +116,8 @@ func NewYurttunnelServerOptions() *YurttunnelServerOptions {
 		serverAgentPort:          constants.YurttunnelServerAgentPort,
 		serverMasterPort:         constants.YurttunnelServerMasterPort,
 		interceptorServerUDSFile: "/tmp/interceptor-proxier.sock",
+		metricsBindAddr:          ":10264",
+		healthBindAddr:           ":10265",
 	}
 	return o
 }
@@ -127,16 +144,36 @@ func (o *YurttunnelServerOptions) complete() error {
 	// try to create the clientset based on the in-cluster config if
 	// the kubeconfig is empty.
 	o.clientset, err = kubeutil.CreateClientSet(o.kubeConfig)
-	return err
+	if err != nil {
+		return err
+	}
+	o.sharedInformerFactory = informers.NewSharedInformerFactory(o.clientset, o.iptablesSyncResync())
+	return nil
+}
+
+// iptablesSyncResync returns the resync period handed to the shared
+// informer factory. It reuses --iptables-sync-period so the periodic
+// safety resync and the informer's own resync period stay in step.
+func (o *YurttunnelServerOptions) iptablesSyncResync() time.Duration {
+	return time.Duration(o.iptablesSyncPeriod) * time.Second
 }
 
 // run starts the yurttunel-server
 func (o *YurttunnelServerOptions) run(stopCh <-chan struct{}) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	// 1. start the IP table manager
+
+	var serverReady int32
+	go startMetricsServer(o.metricsBindAddr)
+	go startHealthServer(o.healthBindAddr, func() bool {
+		return atomic.LoadInt32(&serverReady) != 0
+	})
+
+	// 1. start the IP table manager, reconciling off the shared informer
+	// factory instead of polling on a fixed period
 	if o.enableIptables {
 		iptablesMgr := iptables.NewIptablesManager(o.clientset,
+			o.sharedInformerFactory,
 			o.bindAddr,
 			o.iptablesSyncPeriod,
 			stopCh)
@@ -157,6 +194,9 @@ func (o *YurttunnelServerOptions) run(stopCh <-chan struct{}) error {
 	serverCertMgr.Start()
 	go certmanager.ApproveYurttunnelCSR(o.clientset)
 
+	// the shared informer factory backs the iptables manager
+	o.sharedInformerFactory.Start(stopCh)
+
 	// 3. get the latest certificate
 	_ = wait.PollUntil(5*time.Second, func() (bool, error) {
 		if serverCertMgr.Current() != nil {
@@ -167,6 +207,13 @@ func (o *YurttunnelServerOptions) run(stopCh <-chan struct{}) error {
 		return false, nil
 	}, stopCh)
 
+	// report how long until the certificate currently in use expires, so
+	// an operator can alert on it before the certificate manager's own
+	// rotation has a chance to run
+	go wait.Until(func() {
+		reportCertExpiry(serverCertMgr.Current())
+	}, 30*time.Second, stopCh)
+
 	// 4. generate the TLS configuration based on the latest certificate
 	rootCertPool, err := pki.GenRootCertPool(o.kubeConfig,
 		constants.YurttunnelCAFile)
@@ -184,7 +231,18 @@ func (o *YurttunnelServerOptions) run(stopCh <-chan struct{}) error {
 		o.serverAgentAddr, tlsCfg); err != nil {
 		return err
 	}
+	atomic.StoreInt32(&serverReady, 1)
 
 	<-stopCh
 	return nil
 }
+
+// reportCertExpiry sets metrics.CertExpirySeconds from cert's leaf
+// certificate. It's a no-op if cert is nil (no certificate issued yet)
+// or its leaf hasn't been parsed.
+func reportCertExpiry(cert *tls.Certificate) {
+	if cert == nil || cert.Leaf == nil {
+		return
+	}
+	metrics.CertExpirySeconds.Set(time.Until(cert.Leaf.NotAfter).Seconds())
+}
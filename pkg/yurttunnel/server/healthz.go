@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog"
+)
+
+// startMetricsServer serves Prometheus metrics on addr. It blocks until the
+// listener fails, then logs the error and returns; callers are expected to
+// run it in its own goroutine.
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	klog.Infof("serving metrics at %s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		klog.Errorf("metrics server exited: %v", err)
+	}
+}
+
+// startHealthServer serves /healthz and /readyz on addr. /healthz always
+// reports ok once the process is up; /readyz only reports ok once ready
+// reports true, i.e. the server has a signed certificate and its
+// listeners are accepting connections.
+func startHealthServer(addr string, ready func() bool) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	klog.Infof("serving health checks at %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		klog.Errorf("health server exited: %v", err)
+	}
+}
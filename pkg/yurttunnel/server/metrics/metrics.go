@@ -0,0 +1,80 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics holds the Prometheus metrics yurttunnel-server reports:
+// the iptables manager updates the agent and iptables-sync metrics, and
+// the server's run loop updates the certificate-expiry gauge. Metrics live
+// here, rather than in each subsystem's own package, so every subsystem
+// registers against a single registry without import cycles.
+//
+// No metrics for bytes proxied per direction, per-backend dial errors, or
+// CSR approvals and denials are defined here.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const subsystem = "yurttunnel_server"
+
+var (
+	// AgentsConnected reports, per node name, whether that node's
+	// yurttunnel-agent endpoint is currently ready (1) or not (0).
+	AgentsConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: subsystem,
+		Name:      "agents_connected",
+		Help:      "Whether a yurttunnel-agent is currently connected (1) or not (0), by node name.",
+	}, []string{"node_name"})
+
+	// CertExpirySeconds tracks how long until the certificate currently
+	// in use by the server expires.
+	CertExpirySeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: subsystem,
+		Name:      "cert_expiry_seconds",
+		Help:      "Seconds remaining until the current server certificate expires.",
+	})
+
+	// IptablesSyncTotal, IptablesSyncFailuresTotal and
+	// IptablesSyncDuration track the iptables manager's reconciliation
+	// loop, whether triggered by an informer event or the periodic
+	// safety resync.
+	IptablesSyncTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "iptables_sync_total",
+		Help:      "Total number of attempts to sync the tunnel DNAT iptables rule.",
+	})
+	IptablesSyncFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "iptables_sync_failures_total",
+		Help:      "Total number of failed attempts to sync the tunnel DNAT iptables rule.",
+	})
+	IptablesSyncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Subsystem: subsystem,
+		Name:      "iptables_sync_duration_seconds",
+		Help:      "Time taken to sync the tunnel DNAT iptables rule.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		AgentsConnected,
+		CertExpirySeconds,
+		IptablesSyncTotal,
+		IptablesSyncFailuresTotal,
+		IptablesSyncDuration,
+	)
+}
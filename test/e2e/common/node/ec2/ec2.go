@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ec2
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/alibaba/openyurt/test/e2e/common/node/types"
+)
+
+const (
+	checkStatusInterval = 5 * time.Second
+	checkStatusTimeout  = 3 * time.Minute
+)
+
+// Ec2Controller implements types.NodeController against AWS EC2, so the
+// same autonomy, tunnel-reconnect and revert e2e suites written for
+// Alibaba Cloud can also run in an AWS-backed CI account.
+type Ec2Controller struct {
+	Region string
+	Client *ec2.Client
+}
+
+func NewEc2Controller(region string) (*Ec2Controller, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("fail to load AWS config: %v", err)
+	}
+	return &Ec2Controller{Region: region, Client: ec2.NewFromConfig(cfg)}, nil
+}
+
+func (e *Ec2Controller) RebootNode(instanceId string) error {
+	_, err := e.Client.RebootInstances(context.Background(), &ec2.RebootInstancesInput{
+		InstanceIds: []string{instanceId},
+	})
+	if err != nil {
+		return fmt.Errorf("fail to reboot ec2 instance %s: %v", instanceId, err)
+	}
+	return e.waitForState(instanceId, ec2types.InstanceStateNameRunning)
+}
+
+func (e *Ec2Controller) CreateNode(instanceType, imageId, vswitchId, userData string) (string, error) {
+	out, err := e.Client.RunInstances(context.Background(), &ec2.RunInstancesInput{
+		ImageId:      aws.String(imageId),
+		InstanceType: ec2types.InstanceType(instanceType),
+		SubnetId:     aws.String(vswitchId),
+		UserData:     aws.String(userData),
+		MinCount:     aws.Int32(1),
+		MaxCount:     aws.Int32(1),
+	})
+	if err != nil {
+		return "", fmt.Errorf("fail to run ec2 instance: %v", err)
+	}
+	if len(out.Instances) == 0 {
+		return "", fmt.Errorf("no instance returned by RunInstances")
+	}
+	instanceId := aws.ToString(out.Instances[0].InstanceId)
+	if err := e.waitForState(instanceId, ec2types.InstanceStateNameRunning); err != nil {
+		return instanceId, err
+	}
+	return instanceId, nil
+}
+
+func (e *Ec2Controller) StopNode(instanceId string) error {
+	_, err := e.Client.StopInstances(context.Background(), &ec2.StopInstancesInput{
+		InstanceIds: []string{instanceId},
+	})
+	if err != nil {
+		return fmt.Errorf("fail to stop ec2 instance %s: %v", instanceId, err)
+	}
+	return e.waitForState(instanceId, ec2types.InstanceStateNameStopped)
+}
+
+func (e *Ec2Controller) StartNode(instanceId string) error {
+	_, err := e.Client.StartInstances(context.Background(), &ec2.StartInstancesInput{
+		InstanceIds: []string{instanceId},
+	})
+	if err != nil {
+		return fmt.Errorf("fail to start ec2 instance %s: %v", instanceId, err)
+	}
+	return e.waitForState(instanceId, ec2types.InstanceStateNameRunning)
+}
+
+func (e *Ec2Controller) GetNodeInfo(instanceId string) (*types.NodeAttribute, error) {
+	inst, err := e.describeInstance(instanceId)
+	if err != nil {
+		return nil, err
+	}
+	return &types.NodeAttribute{
+		InstanceId:       aws.ToString(inst.InstanceId),
+		PublicIpAddress:  aws.ToString(inst.PublicIpAddress),
+		PrivateIpAddress: aws.ToString(inst.PrivateIpAddress),
+		Status:           string(inst.State.Name),
+	}, nil
+}
+
+func (e *Ec2Controller) DeleteNode(instanceId string) error {
+	_, err := e.Client.TerminateInstances(context.Background(), &ec2.TerminateInstancesInput{
+		InstanceIds: []string{instanceId},
+	})
+	if err != nil {
+		return fmt.Errorf("fail to terminate ec2 instance %s: %v", instanceId, err)
+	}
+	return nil
+}
+
+func (e *Ec2Controller) describeInstance(instanceId string) (*ec2types.Instance, error) {
+	out, err := e.Client.DescribeInstances(context.Background(), &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceId},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fail to describe ec2 instance %s: %v", instanceId, err)
+	}
+	for _, r := range out.Reservations {
+		for i := range r.Instances {
+			return &r.Instances[i], nil
+		}
+	}
+	return nil, fmt.Errorf("ec2 instance %s not found", instanceId)
+}
+
+func (e *Ec2Controller) waitForState(instanceId string, expect ec2types.InstanceStateName) error {
+	deadline := time.Now().Add(checkStatusTimeout)
+	for time.Now().Before(deadline) {
+		inst, err := e.describeInstance(instanceId)
+		if err != nil {
+			return err
+		}
+		if inst.State.Name == expect {
+			return nil
+		}
+		time.Sleep(checkStatusInterval)
+	}
+	return fmt.Errorf("ec2 instance %s did not reach state %s within %s", instanceId, expect, checkStatusTimeout)
+}
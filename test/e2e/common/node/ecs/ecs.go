@@ -16,15 +16,24 @@ limitations under the License.
 
 package ecs
 
-/*
-TODO
-*/
-
 import (
-	"github.com/alibaba/openyurt/test/e2e/common/node/types"
+	"fmt"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/ecs"
+
+	"github.com/alibaba/openyurt/test/e2e/common/node/types"
+)
+
+const (
+	checkStatusInterval = 5 * time.Second
+	checkStatusTimeout  = 3 * time.Minute
 )
 
+// EcsController implements types.NodeController against Alibaba Cloud
+// ECS, so the autonomy, tunnel-reconnect and revert e2e suites can reboot,
+// stop, start, create and delete a real edge node.
 type EcsController struct {
 	RegionId string
 	Client   *ecs.Client
@@ -39,29 +48,118 @@ func NewEcsController(regionId, accessKeyId, accessKeySecret string) (*EcsContro
 }
 
 func (e *EcsController) RebootNode(instanceId string) error {
-	return nil
+	req := ecs.CreateRebootInstanceRequest()
+	req.InstanceId = instanceId
+	if _, err := e.Client.RebootInstance(req); err != nil {
+		return fmt.Errorf("fail to reboot ecs instance %s: %v", instanceId, err)
+	}
+	return e.waitForStatus(instanceId, "Running")
 }
 
 func (e *EcsController) CreateNode(instanceType, imageId, vswitchId, userData string) (string, error) {
-	return "", nil
+	req := ecs.CreateRunInstancesRequest()
+	req.RegionId = e.RegionId
+	req.InstanceType = instanceType
+	req.ImageId = imageId
+	req.VSwitchId = vswitchId
+	req.UserData = userData
+	req.Amount = requests.NewInteger(1)
+
+	resp, err := e.Client.RunInstances(req)
+	if err != nil {
+		return "", fmt.Errorf("fail to run ecs instance: %v", err)
+	}
+	if len(resp.InstanceIdSets.InstanceIdSet) == 0 {
+		return "", fmt.Errorf("no instance id returned by RunInstances")
+	}
+	instanceId := resp.InstanceIdSets.InstanceIdSet[0]
+	if err := e.waitForStatus(instanceId, "Running"); err != nil {
+		return instanceId, err
+	}
+	return instanceId, nil
 }
 
 func (e *EcsController) StopNode(instanceId string) error {
-	return nil
+	req := ecs.CreateStopInstanceRequest()
+	req.InstanceId = instanceId
+	if _, err := e.Client.StopInstance(req); err != nil {
+		return fmt.Errorf("fail to stop ecs instance %s: %v", instanceId, err)
+	}
+	return e.waitForStatus(instanceId, "Stopped")
 }
 
 func (e *EcsController) StartNode(instanceId string) error {
-	return nil
+	req := ecs.CreateStartInstanceRequest()
+	req.InstanceId = instanceId
+	if _, err := e.Client.StartInstance(req); err != nil {
+		return fmt.Errorf("fail to start ecs instance %s: %v", instanceId, err)
+	}
+	return e.waitForStatus(instanceId, "Running")
 }
 
 func (e *EcsController) GetNodeInfo(instanceId string) (*types.NodeAttribute, error) {
-	return nil, nil
+	inst, err := e.describeInstance(instanceId)
+	if err != nil {
+		return nil, err
+	}
+	attr := &types.NodeAttribute{
+		InstanceId:   inst.InstanceId,
+		InstanceName: inst.InstanceName,
+		Status:       inst.Status,
+	}
+	if len(inst.PublicIpAddress.IpAddress) > 0 {
+		attr.PublicIpAddress = inst.PublicIpAddress.IpAddress[0]
+	}
+	if len(inst.VpcAttributes.PrivateIpAddress.IpAddress) > 0 {
+		attr.PrivateIpAddress = inst.VpcAttributes.PrivateIpAddress.IpAddress[0]
+	}
+	return attr, nil
 }
 
 func (e *EcsController) DeleteNode(instanceId string) error {
+	req := ecs.CreateDeleteInstanceRequest()
+	req.InstanceId = instanceId
+	req.Force = requests.NewBoolean(true)
+	if _, err := e.Client.DeleteInstance(req); err != nil {
+		return fmt.Errorf("fail to delete ecs instance %s: %v", instanceId, err)
+	}
 	return nil
 }
 
+// CheckEcsInstanceStatus reports whether instanceId currently has status
+// expectStatus (e.g. "Running", "Stopped").
 func (e *EcsController) CheckEcsInstanceStatus(instanceId string, expectStatus string) (bool, error) {
-	return false, nil
+	inst, err := e.describeInstance(instanceId)
+	if err != nil {
+		return false, err
+	}
+	return inst.Status == expectStatus, nil
+}
+
+func (e *EcsController) describeInstance(instanceId string) (ecs.Instance, error) {
+	req := ecs.CreateDescribeInstancesRequest()
+	req.InstanceIds = fmt.Sprintf("[%q]", instanceId)
+	resp, err := e.Client.DescribeInstances(req)
+	if err != nil {
+		return ecs.Instance{}, fmt.Errorf("fail to describe ecs instance %s: %v", instanceId, err)
+	}
+	if len(resp.Instances.Instance) == 0 {
+		return ecs.Instance{}, fmt.Errorf("ecs instance %s not found", instanceId)
+	}
+	return resp.Instances.Instance[0], nil
+}
+
+func (e *EcsController) waitForStatus(instanceId, expectStatus string) error {
+	deadline := time.Now().Add(checkStatusTimeout)
+	for time.Now().Before(deadline) {
+		ok, err := e.CheckEcsInstanceStatus(instanceId, expectStatus)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		time.Sleep(checkStatusInterval)
+	}
+	return fmt.Errorf("ecs instance %s did not reach status %s within %s", instanceId, expectStatus, checkStatusTimeout)
 }
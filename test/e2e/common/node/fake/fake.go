@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/alibaba/openyurt/test/e2e/common/node/types"
+)
+
+// FakeController implements types.NodeController against an in-memory
+// set of nodes loaded from a JSON fixture, so the e2e suites can run
+// without any real or virtualized infrastructure (e.g. unit-test-style
+// CI runs that only exercise the suite's own control flow).
+type FakeController struct {
+	fixturePath string
+
+	mu    sync.Mutex
+	nodes map[string]*types.NodeAttribute
+}
+
+// NewFakeController loads a JSON array of types.NodeAttribute from
+// fixturePath and seeds the controller's in-memory node set with it.
+func NewFakeController(fixturePath string) (*FakeController, error) {
+	data, err := ioutil.ReadFile(fixturePath)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read fake node fixture %s: %v", fixturePath, err)
+	}
+	var attrs []types.NodeAttribute
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return nil, fmt.Errorf("fail to parse fake node fixture %s: %v", fixturePath, err)
+	}
+	nodes := make(map[string]*types.NodeAttribute, len(attrs))
+	for i := range attrs {
+		attr := attrs[i]
+		nodes[attr.InstanceId] = &attr
+	}
+	return &FakeController{fixturePath: fixturePath, nodes: nodes}, nil
+}
+
+func (f *FakeController) RebootNode(instanceId string) error {
+	return f.setStatus(instanceId, "Running")
+}
+
+func (f *FakeController) CreateNode(instanceType, imageId, vswitchId, userData string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	instanceId := fmt.Sprintf("fake-%d", len(f.nodes)+1)
+	f.nodes[instanceId] = &types.NodeAttribute{
+		InstanceId:   instanceId,
+		InstanceName: instanceId,
+		Status:       "Running",
+	}
+	return instanceId, nil
+}
+
+func (f *FakeController) StopNode(instanceId string) error {
+	return f.setStatus(instanceId, "Stopped")
+}
+
+func (f *FakeController) StartNode(instanceId string) error {
+	return f.setStatus(instanceId, "Running")
+}
+
+func (f *FakeController) GetNodeInfo(instanceId string) (*types.NodeAttribute, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	node, ok := f.nodes[instanceId]
+	if !ok {
+		return nil, fmt.Errorf("fake node %s not found", instanceId)
+	}
+	attr := *node
+	return &attr, nil
+}
+
+func (f *FakeController) DeleteNode(instanceId string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.nodes[instanceId]; !ok {
+		return fmt.Errorf("fake node %s not found", instanceId)
+	}
+	delete(f.nodes, instanceId)
+	return nil
+}
+
+func (f *FakeController) setStatus(instanceId, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	node, ok := f.nodes[instanceId]
+	if !ok {
+		return fmt.Errorf("fake node %s not found", instanceId)
+	}
+	node.Status = status
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package node
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/alibaba/openyurt/test/e2e/common/node/ec2"
+	"github.com/alibaba/openyurt/test/e2e/common/node/ecs"
+	"github.com/alibaba/openyurt/test/e2e/common/node/fake"
+	"github.com/alibaba/openyurt/test/e2e/common/node/types"
+	"github.com/alibaba/openyurt/test/e2e/common/node/vagrant"
+)
+
+// nodeProvider selects which types.NodeController implementation the e2e
+// suites drive their edge nodes through. It falls back to the
+// E2E_NODE_PROVIDER environment variable when unset, so CI jobs that
+// don't wire test flags can still select a provider.
+var nodeProvider = flag.String("node-provider", "",
+	"the infrastructure provider used to manage e2e test nodes: ecs, ec2, vagrant or fake.")
+
+// NewNodeController returns the types.NodeController selected by
+// --node-provider (or E2E_NODE_PROVIDER if the flag is unset).
+func NewNodeController() (types.NodeController, error) {
+	provider := *nodeProvider
+	if provider == "" {
+		provider = os.Getenv("E2E_NODE_PROVIDER")
+	}
+
+	switch provider {
+	case "ecs":
+		return ecs.NewEcsController(
+			os.Getenv("ECS_REGION_ID"),
+			os.Getenv("ECS_ACCESS_KEY_ID"),
+			os.Getenv("ECS_ACCESS_KEY_SECRET"))
+	case "ec2":
+		return ec2.NewEc2Controller(os.Getenv("EC2_REGION"))
+	case "vagrant":
+		workDir := os.Getenv("VAGRANT_WORK_DIR")
+		if workDir == "" {
+			workDir = "."
+		}
+		return vagrant.NewVagrantController(workDir), nil
+	case "fake":
+		fixture := os.Getenv("FAKE_NODE_FIXTURE")
+		if fixture == "" {
+			return nil, fmt.Errorf("FAKE_NODE_FIXTURE must be set to use the fake node provider")
+		}
+		return fake.NewFakeController(fixture)
+	default:
+		return nil, fmt.Errorf("unknown node provider %q: must be one of ecs, ec2, vagrant, fake", provider)
+	}
+}
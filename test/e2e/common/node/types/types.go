@@ -0,0 +1,42 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+// NodeAttribute describes a single e2e test node, regardless of which
+// provider created it.
+type NodeAttribute struct {
+	InstanceId       string
+	InstanceName     string
+	PublicIpAddress  string
+	PrivateIpAddress string
+	Status           string
+}
+
+// NodeController abstracts the node lifecycle operations the e2e suites
+// need in order to exercise yurt autonomy, tunnel-reconnect and revert:
+// reboot, stop/start (to simulate a network partition), create/delete,
+// and status lookup. Each supported infrastructure (ECS, EC2, a local
+// Vagrant/libvirt box, or a fixture-driven fake) implements this
+// interface, so the suites can run against whichever one is available.
+type NodeController interface {
+	RebootNode(instanceId string) error
+	CreateNode(instanceType, imageId, vswitchId, userData string) (string, error)
+	StopNode(instanceId string) error
+	StartNode(instanceId string) error
+	GetNodeInfo(instanceId string) (*NodeAttribute, error)
+	DeleteNode(instanceId string) error
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 The OpenYurt Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vagrant
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/alibaba/openyurt/test/e2e/common/node/types"
+)
+
+// VagrantController implements types.NodeController against a local
+// Vagrant/libvirt box, so the autonomy, tunnel-reconnect and revert e2e
+// suites can run in CI without any cloud credentials. instanceId is the
+// Vagrant machine name declared in the Vagrantfile, not a cloud instance
+// id.
+type VagrantController struct {
+	// WorkDir is the directory containing the Vagrantfile driving the
+	// local nodes.
+	WorkDir string
+}
+
+func NewVagrantController(workDir string) *VagrantController {
+	return &VagrantController{WorkDir: workDir}
+}
+
+func (v *VagrantController) RebootNode(instanceId string) error {
+	return v.run("reload", instanceId)
+}
+
+func (v *VagrantController) CreateNode(instanceType, imageId, vswitchId, userData string) (string, error) {
+	// instanceType is treated as the Vagrant machine name to bring up;
+	// imageId, vswitchId and userData are cloud-only concepts and have
+	// no Vagrant equivalent, so they're ignored.
+	if err := v.run("up", instanceType); err != nil {
+		return "", err
+	}
+	return instanceType, nil
+}
+
+func (v *VagrantController) StopNode(instanceId string) error {
+	return v.run("halt", instanceId)
+}
+
+func (v *VagrantController) StartNode(instanceId string) error {
+	return v.run("up", instanceId)
+}
+
+func (v *VagrantController) GetNodeInfo(instanceId string) (*types.NodeAttribute, error) {
+	status, err := v.status(instanceId)
+	if err != nil {
+		return nil, err
+	}
+	attr := &types.NodeAttribute{
+		InstanceId:   instanceId,
+		InstanceName: instanceId,
+		Status:       status,
+	}
+	sshCfg, err := v.output("ssh-config", instanceId)
+	if err != nil {
+		return attr, nil
+	}
+	for _, line := range strings.Split(sshCfg, "\n") {
+		fields := strings.Fields(strings.TrimSpace(line))
+		if len(fields) == 2 && fields[0] == "HostName" {
+			attr.PrivateIpAddress = fields[1]
+		}
+	}
+	return attr, nil
+}
+
+func (v *VagrantController) DeleteNode(instanceId string) error {
+	return v.run("destroy", "-f", instanceId)
+}
+
+func (v *VagrantController) status(instanceId string) (string, error) {
+	out, err := v.output("status", instanceId)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, instanceId) {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("fail to parse vagrant status for %s", instanceId)
+}
+
+func (v *VagrantController) run(args ...string) error {
+	cmd := exec.Command("vagrant", args...)
+	cmd.Dir = v.WorkDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("vagrant %s failed: %v: %s", strings.Join(args, " "), err, stderr.String())
+	}
+	return nil
+}
+
+func (v *VagrantController) output(args ...string) (string, error) {
+	cmd := exec.Command("vagrant", args...)
+	cmd.Dir = v.WorkDir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("vagrant %s failed: %v", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}